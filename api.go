@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule tracks when the scheduler's next full check is due, so the
+// control API can report it without the scheduler goroutine blocking on an
+// HTTP request.
+type Schedule struct {
+	mu   sync.RWMutex
+	next time.Time
+}
+
+// Set records when the next full check is due.
+func (s *Schedule) Set(next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next = next
+}
+
+// Next returns when the next full check is due.
+func (s *Schedule) Next() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.next
+}
+
+// ControlAPI exposes the domain registry over HTTP/JSON so domains can be
+// added, removed and inspected at runtime without editing config.yaml.
+// Forced checks are not run inline on the request goroutine; the domain
+// name is handed to checkRequests and the scheduler goroutine in main runs
+// the actual check, so checks (the provider fan-out and the state updates
+// they make) only ever run on that one goroutine. The handlers still read
+// state, and DELETE forgets a domain's state directly, under StateFile's
+// mutex.
+type ControlAPI struct {
+	registry      *DomainRegistry
+	state         *StateFile
+	schedule      *Schedule
+	checkRequests chan<- string
+}
+
+// NewControlAPI builds a ControlAPI bound to the given registry and state.
+func NewControlAPI(registry *DomainRegistry, state *StateFile, schedule *Schedule, checkRequests chan<- string) *ControlAPI {
+	return &ControlAPI{registry: registry, state: state, schedule: schedule, checkRequests: checkRequests}
+}
+
+// StartControlAPIServer starts the control API's HTTP server in the
+// background, mirroring StartMetricsServer's fire-and-forget pattern.
+func StartControlAPIServer(addr string, api *ControlAPI) {
+	mux := http.NewServeMux()
+	mux.Handle("/domains", api)
+	mux.Handle("/domains/", api)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fmt.Printf("Error starting control API server: %s\n", err)
+		}
+	}()
+}
+
+// domainView is the JSON shape returned for a monitored domain. NextCheck is
+// the scheduler's next full-registry check, the same for every domain; a
+// domain can also be checked sooner via POST /domains/{name}/check.
+type domainView struct {
+	Name         string      `json:"name"`
+	Webhooks     []Webhook   `json:"webhooks,omitempty"`
+	Info         *DomainInfo `json:"info,omitempty"`
+	LastNotified time.Time   `json:"last_notified,omitempty"`
+	NextCheck    time.Time   `json:"next_check,omitempty"`
+}
+
+func (api *ControlAPI) view(domain Domain) domainView {
+	info, lastNotified, _ := api.state.getDomain(domain.Name)
+	return domainView{
+		Name:         domain.Name,
+		Webhooks:     domain.Webhooks,
+		Info:         info,
+		LastNotified: lastNotified,
+		NextCheck:    api.schedule.Next(),
+	}
+}
+
+// ServeHTTP routes requests under /domains. Go 1.21's http.ServeMux can't
+// dispatch on method or path parameters, so routing is done by hand here,
+// the same way the rest of this monitor favors explicit code over a
+// framework for small amounts of logic.
+func (api *ControlAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/domains"), "/")
+
+	switch {
+	case name == "":
+		switch r.Method {
+		case http.MethodGet:
+			api.handleList(w, r)
+		case http.MethodPost:
+			api.handleAdd(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	case strings.HasSuffix(name, "/check"):
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		api.handleCheck(w, r, strings.TrimSuffix(name, "/check"))
+	default:
+		switch r.Method {
+		case http.MethodGet:
+			api.handleGet(w, r, name)
+		case http.MethodDelete:
+			api.handleRemove(w, r, name)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func (api *ControlAPI) handleList(w http.ResponseWriter, r *http.Request) {
+	domains := api.registry.List()
+	views := make([]domainView, 0, len(domains))
+	for _, domain := range domains {
+		views = append(views, api.view(domain))
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (api *ControlAPI) handleAdd(w http.ResponseWriter, r *http.Request) {
+	var domain Domain
+	if err := json.NewDecoder(r.Body).Decode(&domain); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %s", err), http.StatusBadRequest)
+		return
+	}
+	if domain.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	api.registry.Add(domain)
+	writeJSON(w, http.StatusCreated, api.view(domain))
+}
+
+func (api *ControlAPI) handleGet(w http.ResponseWriter, r *http.Request, name string) {
+	domain, ok := api.registry.Get(name)
+	if !ok {
+		http.Error(w, "domain not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, api.view(domain))
+}
+
+func (api *ControlAPI) handleRemove(w http.ResponseWriter, r *http.Request, name string) {
+	if !api.registry.Remove(name) {
+		http.Error(w, "domain not found", http.StatusNotFound)
+		return
+	}
+	api.state.forgetDomain(name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *ControlAPI) handleCheck(w http.ResponseWriter, r *http.Request, name string) {
+	if _, ok := api.registry.Get(name); !ok {
+		http.Error(w, "domain not found", http.StatusNotFound)
+		return
+	}
+
+	select {
+	case api.checkRequests <- name:
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "check queue is full, try again shortly", http.StatusServiceUnavailable)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// domainFieldDiff compares two DomainInfo snapshots of the same domain and
+// returns one Event per changed field, so a webhook can subscribe to (say)
+// registrar_changed while ignoring the noisy updated_date_changed via
+// Webhook.On, something a single whole-struct hash couldn't express.
+func domainFieldDiff(domain string, before, after *DomainInfo) []Event {
+	var events []Event
+
+	if before.RegistrarTag != after.RegistrarTag {
+		message := fmt.Sprintf("Registrar changed for %s: %q -> %q", domain, before.RegistrarTag, after.RegistrarTag)
+		events = append(events, newEvent(domain, "registrar_changed", message, before, after))
+	}
+
+	added, removed := diffNameServers(before.NameServers, after.NameServers)
+	if len(added) > 0 {
+		message := fmt.Sprintf("Name servers added for %s: %v", domain, added)
+		events = append(events, newEvent(domain, "nameservers_added", message, before, after))
+	}
+	if len(removed) > 0 {
+		message := fmt.Sprintf("Name servers removed for %s: %v", domain, removed)
+		events = append(events, newEvent(domain, "nameservers_removed", message, before, after))
+	}
+
+	if before.IPAddress != after.IPAddress {
+		message := fmt.Sprintf("IP address changed for %s: %s -> %s", domain, before.IPAddress, after.IPAddress)
+		events = append(events, newEvent(domain, "ip_changed", message, before, after))
+	}
+
+	if !before.CreationDate.Equal(after.CreationDate) && !after.CreationDate.IsZero() {
+		message := fmt.Sprintf("Creation date changed for %s: %s -> %s", domain, before.CreationDate, after.CreationDate)
+		events = append(events, newEvent(domain, "creation_date_changed", message, before, after))
+	}
+
+	if !before.ExpiryDate.Equal(after.ExpiryDate) && !after.ExpiryDate.IsZero() {
+		if before.ExpiryDate.IsZero() || after.ExpiryDate.After(before.ExpiryDate) {
+			message := fmt.Sprintf("Expiry date extended for %s: %s -> %s", domain, before.ExpiryDate, after.ExpiryDate)
+			events = append(events, newEvent(domain, "expiry_extended", message, before, after))
+		} else {
+			message := fmt.Sprintf("Expiry date shortened for %s: %s -> %s", domain, before.ExpiryDate, after.ExpiryDate)
+			events = append(events, newEvent(domain, "expiry_shortened", message, before, after))
+		}
+	}
+
+	if !before.UpdatedDate.Equal(after.UpdatedDate) && !after.UpdatedDate.IsZero() {
+		message := fmt.Sprintf("WHOIS updated-date changed for %s: %s -> %s", domain, before.UpdatedDate, after.UpdatedDate)
+		events = append(events, newEvent(domain, "updated_date_changed", message, before, after))
+	}
+
+	addedKeys, removedKeys := diffNameServers(before.DNSKEYRecords, after.DNSKEYRecords)
+	if len(after.DNSKEYRecords) > 0 && (len(addedKeys) > 0 || len(removedKeys) > 0) {
+		message := fmt.Sprintf("DNSKEY records changed for %s: %d added, %d removed", domain, len(addedKeys), len(removedKeys))
+		events = append(events, newEvent(domain, "dnskey_changed", message, before, after))
+	}
+
+	if !before.CertificateIssuedAt.Equal(after.CertificateIssuedAt) && !after.CertificateIssuedAt.IsZero() {
+		message := fmt.Sprintf("New certificate issued for %s at %s: %v", domain, after.CertificateIssuedAt, after.CertificateSANs)
+		events = append(events, newEvent(domain, "certificate_issued", message, before, after))
+	}
+
+	return events
+}
+
+// defaultExpiryWarningDays is used when Config.ExpiryWarningDays is empty.
+var defaultExpiryWarningDays = []int{30, 14, 7, 1}
+
+// expiryWarningThresholds returns the configured expiry warning thresholds,
+// falling back to defaultExpiryWarningDays when none are configured.
+func expiryWarningThresholds(config *Config) []int {
+	if len(config.ExpiryWarningDays) == 0 {
+		return defaultExpiryWarningDays
+	}
+	return config.ExpiryWarningDays
+}
+
+// expiryWarningEvents returns one expiry_warning Event per threshold the
+// domain's remaining time has crossed since the last check, so the warning
+// fires even when nothing else about the WHOIS record changed. Thresholds
+// already sent for a domain are tracked in state so they don't repeat every
+// interval, and are cleared when the expiry date is extended (see the
+// expiry_extended handling in MonitorDomains).
+func expiryWarningEvents(domain string, info *DomainInfo, thresholds []int, state *StateFile) []Event {
+	if info.ExpiryDate.IsZero() {
+		return nil
+	}
+
+	daysRemaining := time.Until(info.ExpiryDate).Hours() / 24
+	sent := state.sentExpiryWarnings(domain)
+
+	var events []Event
+	var newlySent []int
+	for _, threshold := range thresholds {
+		if daysRemaining > float64(threshold) || containsInt(sent, threshold) {
+			continue
+		}
+
+		message := fmt.Sprintf("%s expires in %.0f day(s), crossing the %d day warning threshold", domain, daysRemaining, threshold)
+		events = append(events, newEvent(domain, "expiry_warning", message, nil, info))
+		newlySent = append(newlySent, threshold)
+	}
+
+	if len(newlySent) > 0 {
+		state.recordExpiryWarnings(domain, newlySent)
+	}
+
+	return events
+}
+
+func containsInt(values []int, target int) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
@@ -1,25 +1,28 @@
 package main
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"encoding/json"
+	"context"
 	"fmt"
 	"net"
-	"net/http"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
-	whois "github.com/likexian/whois"
 	whoisparser "github.com/likexian/whois-parser"
 	"gopkg.in/yaml.v2"
 )
 
 // Config struct for the YAML configuration
 type Config struct {
-	Interval int       `yaml:"interval"`
-	Domains  []Domain  `yaml:"domains"`
-	Webhooks []Webhook `yaml:"webhooks"`
+	Interval          int       `yaml:"interval"`
+	Domains           []Domain  `yaml:"domains"`
+	Webhooks          []Webhook `yaml:"webhooks"`
+	MetricsListen     string    `yaml:"metrics_listen"`
+	ControlListen     string    `yaml:"control_listen"`
+	Providers         []string  `yaml:"providers"`
+	StateFile         string    `yaml:"state_file"`
+	ExpiryWarningDays []int     `yaml:"expiry_warning_days"`
 }
 
 // Domain struct for domain configuration
@@ -30,19 +33,32 @@ type Domain struct {
 
 // Webhook struct for webhook configuration
 type Webhook struct {
-	Type string `yaml:"type"`
-	URL  string `yaml:"url"`
+	Type string   `yaml:"type"`
+	URL  string   `yaml:"url"`
+	On   []string `yaml:"on"` // event types this webhook receives; empty means all
 }
 
-// DomainInfo struct to hold WHOIS information and DNS resolution
+// DomainInfo struct to hold WHOIS information and DNS resolution. Each
+// provider populates the subset of fields it is responsible for; see
+// mergeDomainInfo for how the per-provider results are combined.
 type DomainInfo struct {
-	Domain       string
-	RegistrarTag string
-	NameServers  []string
-	CreationDate time.Time
-	ExpiryDate   time.Time
-	UpdatedDate  time.Time
-	IPAddress    string
+	Domain            string
+	RegistrarTag      string
+	NameServers       []string
+	CreationDate      time.Time
+	ExpiryDate        time.Time
+	UpdatedDate       time.Time
+	IPAddress         string
+	DateParseFailures []string // names of DomainInfo date fields whose raw value could not be parsed
+
+	MXRecords     []string
+	TXTRecords    []string
+	DNSKEYRecords []string
+	DSRecords     []string
+	DNSSECValid   bool
+
+	CertificateSANs     []string
+	CertificateIssuedAt time.Time
 }
 
 // LoadConfig loads the configuration from a YAML file
@@ -85,15 +101,27 @@ func ParseWHOIS(domain string, response string) (*DomainInfo, error) {
 	}
 
 	if result.Domain.CreatedDate != "" {
-		domainInfo.CreationDate = parseDate(result.Domain.CreatedDate)
+		if t, ok := parseDate(result.Domain.CreatedDate); ok {
+			domainInfo.CreationDate = t
+		} else {
+			domainInfo.DateParseFailures = append(domainInfo.DateParseFailures, "CreationDate")
+		}
 	}
 
 	if result.Domain.ExpirationDate != "" {
-		domainInfo.ExpiryDate = parseDate(result.Domain.ExpirationDate)
+		if t, ok := parseDate(result.Domain.ExpirationDate); ok {
+			domainInfo.ExpiryDate = t
+		} else {
+			domainInfo.DateParseFailures = append(domainInfo.DateParseFailures, "ExpiryDate")
+		}
 	}
 
 	if result.Domain.UpdatedDate != "" {
-		domainInfo.UpdatedDate = parseDate(result.Domain.UpdatedDate)
+		if t, ok := parseDate(result.Domain.UpdatedDate); ok {
+			domainInfo.UpdatedDate = t
+		} else {
+			domainInfo.DateParseFailures = append(domainInfo.DateParseFailures, "UpdatedDate")
+		}
 	}
 
 	return domainInfo, nil
@@ -111,182 +139,249 @@ func ResolveIP(domain string) (string, error) {
 	return ips[0].String(), nil
 }
 
-// parseDate attempts to parse a date string using multiple formats
-func parseDate(dateStr string) time.Time {
-	formats := []string{
-		time.RFC3339,
-		"2006-01-02T15:04:05Z",     // Example: 2006-01-02T15:04:05Z
-		"2006-01-02 15:04:05",      // Example: 2006-01-02 15:04:05
-		"2006-01-02",               // Example: 2006-01-02
-		"02-Jan-2006",              // Example: 02-Jan-2006
-		"02-Jan-2006 15:04:05 MST", // Example: 02-Jan-2006 15:04:05 MST
-	}
-
-	var parsedDate time.Time
-	var err error
-	for _, format := range formats {
-		parsedDate, err = time.Parse(format, dateStr)
-		if err == nil {
-			return parsedDate
-		}
-	}
-
-	// If no format matched, return the zero time
-	return time.Time{}
+// dateFormats lists the layouts parseDate tries, in order, against a
+// normalized date string. Registries are inconsistent about exact format,
+// so this casts a wide net rather than assuming a single WHOIS dialect.
+var dateFormats = []string{
+	time.RFC3339,
+	time.RFC3339Nano,
+	time.RFC1123,
+	time.RFC1123Z,
+	time.ANSIC,
+	time.UnixDate,
+	"2006-01-02T15:04:05Z",
+	"2006-01-02T15:04:05-07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006.01.02",
+	"02/01/2006",
+	"01/02/2006",
+	"02-Jan-2006",
+	"02-Jan-2006 15:04:05 MST",
+	"2 January 2006",
+	"2-January-2006",
+	"January 2, 2006",
+	"Mon Jan _2 15:04:05 2006",
+	"Mon Jan _2 15:04:05 2006 MST",
+	"20060102",
 }
 
-// HashDomainInfo computes a hash for the DomainInfo struct to detect changes
-func HashDomainInfo(info *DomainInfo) string {
-	data := fmt.Sprintf("%v", *info)
-	return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+var (
+	trailingParenRe = regexp.MustCompile(`\s*\([^)]*\)\s*$`)
+	repeatedSpaceRe = regexp.MustCompile(`\s+`)
+	monthNameRe     = regexp.MustCompile(`(?i)\b(january|february|march|april|may|june|july|august|september|october|november|december|jan|feb|mar|apr|jun|jul|aug|sep|sept|oct|nov|dec)\b`)
+)
+
+// normalizeDateString cleans up common registry quirks (trailing timezone
+// descriptions in parentheses, doubled whitespace, inconsistently cased
+// month names) before the string is handed to time.Parse.
+func normalizeDateString(dateStr string) string {
+	normalized := trailingParenRe.ReplaceAllString(dateStr, "")
+	normalized = strings.TrimSpace(normalized)
+	normalized = repeatedSpaceRe.ReplaceAllString(normalized, " ")
+	normalized = monthNameRe.ReplaceAllStringFunc(normalized, func(month string) string {
+		return strings.ToUpper(month[:1]) + strings.ToLower(month[1:])
+	})
+	return normalized
 }
 
-// SendWebhook sends a notification to the specified webhook URL
-func SendWebhook(webhook Webhook, message string, domainInfo *DomainInfo) error {
-	var payload []byte
-	var err error
-
-	switch webhook.Type {
-	case "pagerduty":
-		payload, err = json.Marshal(map[string]interface{}{
-			"payload": map[string]string{
-				"summary":  message,
-				"severity": "info",
-				"source":   "domain-monitor",
-			},
-			"routing_key":  webhook.URL, // Assuming the URL here is the routing key for PagerDuty
-			"event_action": "trigger",
-		})
-	case "teams":
-		payload, err = json.Marshal(map[string]string{"text": message})
-	case "discord":
-		embed := map[string]interface{}{
-			"title":       message,
-			"description": fmt.Sprintf("Details: \n- Domain: %s\n- Registrar: %s\n- Name Servers: %v\n- Creation Date: %s\n- Expiry Date: %s\n- Updated Date: %s\n- IP Address: %s", domainInfo.Domain, domainInfo.RegistrarTag, domainInfo.NameServers, domainInfo.CreationDate, domainInfo.ExpiryDate, domainInfo.UpdatedDate, domainInfo.IPAddress),
-			"color":       3447003, // Blue color
+// parseDate attempts to parse a date string using a broad set of layouts,
+// normalizing known registry quirks first. The second return value reports
+// whether parsing succeeded, so callers can distinguish a failed parse from
+// a genuinely absent date rather than silently treating both as zero time.
+func parseDate(dateStr string) (time.Time, bool) {
+	normalized := normalizeDateString(dateStr)
+	for _, format := range dateFormats {
+		if parsedDate, err := time.Parse(format, normalized); err == nil {
+			return parsedDate, true
 		}
-		payload, err = json.Marshal(map[string]interface{}{
-			"embeds": []map[string]interface{}{embed},
-		})
-	default:
-		return fmt.Errorf("unsupported webhook type: %s", webhook.Type)
-	}
-
-	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest("POST", webhook.URL, bytes.NewBuffer(payload))
-	if err != nil {
-		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 300 {
-		return fmt.Errorf("received non-2xx response status: %d", resp.StatusCode)
-	}
+	return time.Time{}, false
+}
 
-	return nil
+// domainTLD returns the last label of a domain name, lower-cased.
+func domainTLD(domain string) string {
+	parts := strings.Split(strings.Trim(domain, "."), ".")
+	return strings.ToLower(parts[len(parts)-1])
 }
 
-// MonitorDomains monitors the domains based on the configuration and sends notifications on changes
-func MonitorDomains(config *Config, previousStates map[string]string) map[string]string {
-	currentStates := make(map[string]string)
+// MonitorDomains checks domains (which may be the registry's full view or,
+// for a control-API-forced check, a single domain) and sends per-field
+// change notifications, updating state with the latest DomainInfo snapshots
+// and notification timestamps. It never treats a domain missing from
+// domains as removed - see reconcileRemovedDomains for that, which must be
+// run against the full registry, not a forced check's subset.
+func MonitorDomains(domains []Domain, config *Config, state *StateFile, metrics *MetricsRegistry) {
+	previousDomains := state.snapshotDomains()
+	providers := configuredProviders(config)
+	thresholds := expiryWarningThresholds(config)
+
+	for _, domain := range domains {
+		domainInfo := &DomainInfo{Domain: domain.Name}
+		succeeded := false
+
+		for _, name := range providers {
+			provider, ok := providerRegistry[name]
+			if !ok {
+				fmt.Printf("Unknown provider %q configured for %s\n", name, domain.Name)
+				continue
+			}
 
-	for _, domain := range config.Domains {
-		response, err := whois.Whois(domain.Name)
-		if err != nil {
-			fmt.Printf("Error fetching WHOIS information for %s: %s\n", domain.Name, err)
-			continue
+			info, err := provider.Lookup(context.Background(), domain.Name)
+			if err != nil {
+				fmt.Printf("Error running %s provider for %s: %s\n", name, domain.Name, err)
+				continue
+			}
+
+			mergeDomainInfo(domainInfo, info)
+			succeeded = true
 		}
 
-		domainInfo, err := ParseWHOIS(domain.Name, response)
-		if err != nil {
-			fmt.Printf("Error parsing WHOIS information for %s: %s\n", domain.Name, err)
+		if !succeeded {
+			metrics.RecordLookup(domain.Name, nil, fmt.Errorf("all providers failed for %s", domain.Name))
 			continue
 		}
 
-		ip, err := ResolveIP(domain.Name)
-		if err != nil {
-			fmt.Printf("Error resolving IP address for %s: %s\n", domain.Name, err)
-			continue
+		metrics.RecordLookup(domain.Name, domainInfo, nil)
+		if len(domainInfo.DateParseFailures) > 0 {
+			metrics.RecordDateParseFailure(domain.Name, len(domainInfo.DateParseFailures))
 		}
-		domainInfo.IPAddress = ip
 
-		hash := HashDomainInfo(domainInfo)
-		currentStates[domain.Name] = hash
+		dests := append(append([]Webhook{}, domain.Webhooks...), config.Webhooks...)
 
-		if previousHash, found := previousStates[domain.Name]; !found {
+		previous, found := previousDomains[domain.Name]
+		if !found {
 			message := fmt.Sprintf("Monitoring enabled for domain: %s", domain.Name)
-			for _, webhook := range domain.Webhooks {
-				if err := SendWebhook(webhook, message, domainInfo); err != nil {
-					fmt.Printf("Error sending webhook for %s: %s\n", domain.Name, err)
-				}
-			}
-			for _, webhook := range config.Webhooks {
-				if err := SendWebhook(webhook, message, domainInfo); err != nil {
-					fmt.Printf("Error sending webhook for %s: %s\n", domain.Name, err)
-				}
-			}
-		} else if previousHash != hash {
-			message := fmt.Sprintf("Domain information changed for: %s", domain.Name)
-			for _, webhook := range domain.Webhooks {
-				if err := SendWebhook(webhook, message, domainInfo); err != nil {
-					fmt.Printf("Error sending webhook for %s: %s\n", domain.Name, err)
+			dispatchEvent(context.Background(), dests, newEvent(domain.Name, "enabled", message, nil, domainInfo))
+			state.markNotified(domain.Name)
+		} else {
+			events := domainFieldDiff(domain.Name, previous, domainInfo)
+			for _, event := range events {
+				dispatchEvent(context.Background(), dests, event)
+				if event.ChangeType == "expiry_extended" {
+					state.clearExpiryWarnings(domain.Name)
 				}
 			}
-			for _, webhook := range config.Webhooks {
-				if err := SendWebhook(webhook, message, domainInfo); err != nil {
-					fmt.Printf("Error sending webhook for %s: %s\n", domain.Name, err)
-				}
+			if len(events) > 0 {
+				state.markNotified(domain.Name)
 			}
 		}
+
+		for _, event := range expiryWarningEvents(domain.Name, domainInfo, thresholds, state) {
+			dispatchEvent(context.Background(), dests, event)
+			state.markNotified(domain.Name)
+		}
+
+		state.setDomain(domain.Name, domainInfo)
 	}
+}
 
-	for domainName := range previousStates {
-		if _, found := currentStates[domainName]; !found {
-			message := fmt.Sprintf("Monitoring finished for domain: %s", domainName)
-			for _, domain := range config.Domains {
-				if domain.Name == domainName {
-					for _, webhook := range domain.Webhooks {
-						if err := SendWebhook(webhook, message, nil); err != nil {
-							fmt.Printf("Error sending webhook for %s: %s\n", domainName, err)
-						}
-					}
-				}
-			}
-			for _, webhook := range config.Webhooks {
-				if err := SendWebhook(webhook, message, nil); err != nil {
-					fmt.Printf("Error sending webhook for %s: %s\n", domainName, err)
-				}
+// reconcileRemovedDomains fires a "finished" notification and forgets state
+// for every domain state has previously observed but that no longer appears
+// in domains. Callers must pass the full current domain set (registry.List()),
+// never the single-element slice used for a control-API-forced check, or
+// every other monitored domain would be wrongly treated as removed.
+func reconcileRemovedDomains(domains []Domain, config *Config, state *StateFile) {
+	current := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		current[domain.Name] = true
+	}
+
+	for domainName, previous := range state.snapshotDomains() {
+		if current[domainName] {
+			continue
+		}
+
+		message := fmt.Sprintf("Monitoring finished for domain: %s", domainName)
+		var dests []Webhook
+		for _, domain := range domains {
+			if domain.Name == domainName {
+				dests = append(dests, domain.Webhooks...)
 			}
 		}
+		dests = append(dests, config.Webhooks...)
+		dispatchEvent(context.Background(), dests, newEvent(domainName, "finished", message, previous, nil))
+		state.forgetDomain(domainName)
 	}
-
-	return currentStates
 }
 
 func main() {
 	configPath := "config.yaml"
-	previousStates := make(map[string]string)
+	metrics := NewMetricsRegistry()
 
-	for {
-		config, err := LoadConfig(configPath)
-		if err != nil {
-			fmt.Printf("Error loading config: %s\n", err)
-			return
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		fmt.Printf("Error loading config: %s\n", err)
+		return
+	}
+
+	state, err := LoadState(config.StateFile)
+	if err != nil {
+		fmt.Printf("Error loading state from %s, starting fresh: %s\n", config.StateFile, err)
+		state = NewStateFile()
+	}
+
+	registry := NewDomainRegistry(config.Domains)
+
+	if config.MetricsListen != "" {
+		StartMetricsServer(config.MetricsListen, metrics)
+	}
+
+	// checkRequests carries domain names from the control API's POST
+	// /domains/{name}/check handler to the scheduler loop below, which is
+	// the only goroutine allowed to run MonitorDomains, keeping provider
+	// fan-out and the checks' state writes single-threaded even though
+	// requests can arrive from the HTTP server concurrently (the control
+	// API's DELETE handler still forgets state directly, under StateFile's
+	// mutex). schedule lets the control API report the next full check's
+	// due time, which is set from that same goroutine.
+	checkRequests := make(chan string, 16)
+	schedule := &Schedule{}
+	if config.ControlListen != "" {
+		StartControlAPIServer(config.ControlListen, NewControlAPI(registry, state, schedule, checkRequests))
+	}
+
+	// runCheck runs MonitorDomains over domains and persists state. fullSync
+	// must only be true when domains is the registry's complete current set
+	// (registry.List()); it also reconciles domains removed from that set,
+	// which would wrongly fire for every other domain if run against the
+	// single-element slice a forced check passes.
+	runCheck := func(domains []Domain, fullSync bool) {
+		MonitorDomains(domains, config, state, metrics)
+		if fullSync {
+			reconcileRemovedDomains(domains, config, state)
+		}
+		if err := SaveState(config.StateFile, state); err != nil {
+			fmt.Printf("Error saving state to %s: %s\n", config.StateFile, err)
 		}
+	}
+
+	interval := time.Duration(config.Interval) * time.Minute
+	schedule.Set(time.Now().Add(interval))
+	runCheck(registry.List(), true)
 
-		previousStates = MonitorDomains(config, previousStates)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-		time.Sleep(time.Duration(config.Interval) * time.Minute)
+	for {
+		select {
+		case domainName := <-checkRequests:
+			if domain, ok := registry.Get(domainName); ok {
+				runCheck([]Domain{domain}, false)
+			}
+		case <-ticker.C:
+			if reloaded, err := LoadConfig(configPath); err != nil {
+				fmt.Printf("Error loading config: %s\n", err)
+			} else {
+				config = reloaded
+				registry.Sync(config.Domains)
+				interval = time.Duration(config.Interval) * time.Minute
+				ticker.Reset(interval)
+			}
+			schedule.Set(time.Now().Add(interval))
+			runCheck(registry.List(), true)
+		}
 	}
 }
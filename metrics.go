@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DomainMetrics holds the latest observed metrics for a single domain.
+type DomainMetrics struct {
+	ExpirySeconds       float64
+	LastWHOISUpdateDays float64
+	ResolutionSuccess   bool
+	LastCheckTimestamp  int64
+	ResolutionErrors    int64
+	DateParseFailures   int64
+}
+
+// MetricsRegistry tracks per-domain metrics for the Prometheus scrape endpoint.
+type MetricsRegistry struct {
+	mu      sync.Mutex
+	domains map[string]*DomainMetrics
+}
+
+// NewMetricsRegistry creates an empty metrics registry.
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{domains: make(map[string]*DomainMetrics)}
+}
+
+// RecordLookup updates the metrics for domain following a WHOIS/DNS lookup attempt.
+// Pass a nil info and non-nil lookupErr to record a failed lookup.
+func (r *MetricsRegistry) RecordLookup(domain string, info *DomainInfo, lookupErr error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.domains[domain]
+	if !ok {
+		m = &DomainMetrics{}
+		r.domains[domain] = m
+	}
+
+	if lookupErr != nil {
+		m.ResolutionSuccess = false
+		m.ResolutionErrors++
+		return
+	}
+
+	m.ResolutionSuccess = true
+	m.LastCheckTimestamp = time.Now().Unix()
+
+	if info == nil {
+		return
+	}
+
+	if !info.ExpiryDate.IsZero() {
+		m.ExpirySeconds = time.Until(info.ExpiryDate).Seconds()
+	}
+	if !info.UpdatedDate.IsZero() {
+		m.LastWHOISUpdateDays = time.Since(info.UpdatedDate).Hours() / 24
+	}
+}
+
+// RecordDateParseFailure accounts for WHOIS date fields that were present
+// but could not be parsed, so silent zero-time dates can't mask the gap.
+func (r *MetricsRegistry) RecordDateParseFailure(domain string, count int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, ok := r.domains[domain]
+	if !ok {
+		m = &DomainMetrics{}
+		r.domains[domain] = m
+	}
+	m.DateParseFailures += int64(count)
+}
+
+// ServeHTTP renders the registry in the Prometheus text exposition format.
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.domains))
+	for name := range r.domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	writeMetric(w, "domainmonitor_expiry_seconds", "gauge", "Seconds remaining until domain expiry", names, r.domains,
+		func(m *DomainMetrics) float64 { return m.ExpirySeconds })
+	writeMetric(w, "domainmonitor_last_whois_update_days", "gauge", "Days since the registrar last updated the domain record", names, r.domains,
+		func(m *DomainMetrics) float64 { return m.LastWHOISUpdateDays })
+	writeMetric(w, "domainmonitor_last_check_timestamp", "gauge", "Unix timestamp of the last successful check", names, r.domains,
+		func(m *DomainMetrics) float64 { return float64(m.LastCheckTimestamp) })
+	writeMetric(w, "domainmonitor_resolution_success", "gauge", "1 if the most recent lookup succeeded, 0 otherwise", names, r.domains,
+		func(m *DomainMetrics) float64 {
+			if m.ResolutionSuccess {
+				return 1
+			}
+			return 0
+		})
+	writeMetric(w, "domainmonitor_resolution_errors_total", "counter", "Total number of failed WHOIS/DNS lookups", names, r.domains,
+		func(m *DomainMetrics) float64 { return float64(m.ResolutionErrors) })
+	writeMetric(w, "domainmonitor_date_parse_failures_total", "counter", "Total number of WHOIS date fields that could not be parsed", names, r.domains,
+		func(m *DomainMetrics) float64 { return float64(m.DateParseFailures) })
+}
+
+func writeMetric(w io.Writer, name, metricType, help string, names []string, domains map[string]*DomainMetrics, value func(*DomainMetrics) float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	for _, domain := range names {
+		fmt.Fprintf(w, "%s{domain=%q} %v\n", name, domain, value(domains[domain]))
+	}
+}
+
+// StartMetricsServer starts the Prometheus scrape endpoint in the background.
+func StartMetricsServer(addr string, registry *MetricsRegistry) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fmt.Printf("Error starting metrics server: %s\n", err)
+		}
+	}()
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	whois "github.com/likexian/whois"
+	whoisparser "github.com/likexian/whois-parser"
+	"github.com/miekg/dns"
+)
+
+// Provider gathers a subset of DomainInfo for a domain from a single
+// backend. MonitorDomains fans out to the configured providers, merges
+// their results with mergeDomainInfo and compares the merged result field
+// by field with domainFieldDiff, so WHOIS, RDAP, DNSKEY and
+// certificate-transparency changes can all trigger a notification. MX, TXT
+// and DS record changes are recorded but not compared.
+type Provider interface {
+	Lookup(ctx context.Context, domain string) (*DomainInfo, error)
+}
+
+// providerRegistry maps the provider names usable in Config.Providers to
+// their implementation.
+var providerRegistry = map[string]Provider{
+	"whois": WHOISProvider{},
+	"rdap":  RDAPProvider{},
+	"dns":   DNSProvider{},
+	"ct":    CTProvider{},
+}
+
+// configuredProviders returns the provider names enabled in config,
+// defaulting to the monitor's original whois+IP behavior when none are set.
+func configuredProviders(config *Config) []string {
+	if len(config.Providers) == 0 {
+		return []string{"whois"}
+	}
+	return config.Providers
+}
+
+// mergeDomainInfo copies every field src populated into dst, leaving fields
+// dst already has untouched when src didn't set them. DateParseFailures is
+// the one field accumulated rather than overwritten, since more than one
+// provider can report a bad date.
+func mergeDomainInfo(dst *DomainInfo, src *DomainInfo) {
+	if src.RegistrarTag != "" {
+		dst.RegistrarTag = src.RegistrarTag
+	}
+	if len(src.NameServers) > 0 {
+		dst.NameServers = src.NameServers
+	}
+	if !src.CreationDate.IsZero() {
+		dst.CreationDate = src.CreationDate
+	}
+	if !src.ExpiryDate.IsZero() {
+		dst.ExpiryDate = src.ExpiryDate
+	}
+	if !src.UpdatedDate.IsZero() {
+		dst.UpdatedDate = src.UpdatedDate
+	}
+	if src.IPAddress != "" {
+		dst.IPAddress = src.IPAddress
+	}
+	dst.DateParseFailures = append(dst.DateParseFailures, src.DateParseFailures...)
+	if len(src.MXRecords) > 0 {
+		dst.MXRecords = src.MXRecords
+	}
+	if len(src.TXTRecords) > 0 {
+		dst.TXTRecords = src.TXTRecords
+	}
+	if len(src.DNSKEYRecords) > 0 {
+		dst.DNSKEYRecords = src.DNSKEYRecords
+	}
+	if len(src.DSRecords) > 0 {
+		dst.DSRecords = src.DSRecords
+	}
+	if src.DNSSECValid {
+		dst.DNSSECValid = true
+	}
+	if len(src.CertificateSANs) > 0 {
+		dst.CertificateSANs = src.CertificateSANs
+	}
+	if !src.CertificateIssuedAt.IsZero() {
+		dst.CertificateIssuedAt = src.CertificateIssuedAt
+	}
+}
+
+// expiryRequery describes how to re-query a registry that omits the
+// expiration date from its default WHOIS response.
+type expiryRequery struct {
+	server string // WHOIS server to query directly
+	prefix string // flag prepended to the domain in the query line
+}
+
+// tldExpiryRequeries maps TLDs known to omit the expiration date from their
+// default WHOIS response to the server/flag combination that returns the
+// full record. JPRS (.jp) requires a "= domain" query to include dates;
+// DENIC (.de) has no equivalent flag, since its WHOIS policy omits expiry
+// entirely, so it is intentionally not listed here.
+var tldExpiryRequeries = map[string]expiryRequery{
+	"jp": {server: "whois.jprs.jp", prefix: "= "},
+}
+
+// requeryExpiryDate re-queries a registry's WHOIS server with the given
+// prefix flag and returns the expiration date parsed from the response.
+func requeryExpiryDate(domain string, requery expiryRequery) (time.Time, bool) {
+	response, err := whois.Whois(requery.prefix+domain, requery.server)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	result, err := whoisparser.Parse(response)
+	if err != nil || result.Domain.ExpirationDate == "" {
+		return time.Time{}, false
+	}
+
+	return parseDate(result.Domain.ExpirationDate)
+}
+
+// WHOISProvider reproduces the monitor's original behavior: a WHOIS lookup,
+// the TLD-specific expiry requery, and an IP resolution (A or AAAA, first
+// address returned) for the apex.
+type WHOISProvider struct{}
+
+// Lookup implements Provider.
+func (WHOISProvider) Lookup(ctx context.Context, domain string) (*DomainInfo, error) {
+	response, err := whois.Whois(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := ParseWHOIS(domain, response)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.ExpiryDate.IsZero() {
+		if requery, ok := tldExpiryRequeries[domainTLD(domain)]; ok {
+			if expiry, ok := requeryExpiryDate(domain, requery); ok {
+				info.ExpiryDate = expiry
+			}
+		}
+	}
+
+	ip, err := ResolveIP(domain)
+	if err != nil {
+		return nil, err
+	}
+	info.IPAddress = ip
+
+	return info, nil
+}
+
+// rdapBootstrap caches the IANA RDAP bootstrap registry (data.iana.org/rdap/dns.json)
+// for the life of the process, since it changes rarely and every domain lookup
+// would otherwise refetch it.
+type rdapBootstrap struct {
+	servers map[string]string // TLD -> RDAP base URL
+}
+
+var rdapDNSBootstrap = &rdapBootstrap{}
+
+func (b *rdapBootstrap) serverFor(ctx context.Context, tld string) (string, error) {
+	if b.servers == nil {
+		servers, err := fetchRDAPBootstrap(ctx)
+		if err != nil {
+			return "", err
+		}
+		b.servers = servers
+	}
+
+	server, ok := b.servers[tld]
+	if !ok {
+		return "", fmt.Errorf("rdap: no server known for .%s", tld)
+	}
+	return server, nil
+}
+
+func fetchRDAPBootstrap(ctx context.Context) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://data.iana.org/rdap/dns.json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var bootstrap struct {
+		Services [][]interface{} `json:"services"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&bootstrap); err != nil {
+		return nil, err
+	}
+
+	servers := make(map[string]string)
+	for _, service := range bootstrap.Services {
+		if len(service) != 2 {
+			continue
+		}
+		tlds, _ := service[0].([]interface{})
+		urls, _ := service[1].([]interface{})
+		if len(urls) == 0 {
+			continue
+		}
+		base, _ := urls[0].(string)
+		for _, t := range tlds {
+			if tld, ok := t.(string); ok {
+				servers[strings.ToLower(tld)] = base
+			}
+		}
+	}
+
+	return servers, nil
+}
+
+// rdapResponse captures the subset of an RDAP domain response this monitor
+// cares about. See RFC 9083 for the full schema.
+type rdapResponse struct {
+	Nameservers []struct {
+		LDHName string `json:"ldhName"`
+	} `json:"nameservers"`
+	Events []struct {
+		Action string `json:"eventAction"`
+		Date   string `json:"eventDate"`
+	} `json:"events"`
+	SecureDNS struct {
+		DelegationSigned bool `json:"delegationSigned"`
+	} `json:"secureDNS"`
+}
+
+// RDAPProvider looks up a domain via its registry's RDAP service, resolved
+// through the IANA bootstrap registry, as a JSON alternative to WHOIS that
+// doesn't need per-registry response parsing.
+type RDAPProvider struct{}
+
+// Lookup implements Provider.
+func (RDAPProvider) Lookup(ctx context.Context, domain string) (*DomainInfo, error) {
+	base, err := rdapDNSBootstrap.serverFor(ctx, domainTLD(domain))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(base, "/")+"/domain/"+domain, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rdap: unexpected status %d for %s", resp.StatusCode, domain)
+	}
+
+	var parsed rdapResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+
+	info := &DomainInfo{Domain: domain, DNSSECValid: parsed.SecureDNS.DelegationSigned}
+	for _, ns := range parsed.Nameservers {
+		if ns.LDHName != "" {
+			info.NameServers = append(info.NameServers, strings.ToLower(ns.LDHName))
+		}
+	}
+	for _, event := range parsed.Events {
+		t, ok := parseDate(event.Date)
+		if !ok {
+			continue
+		}
+		switch event.Action {
+		case "registration":
+			info.CreationDate = t
+		case "expiration":
+			info.ExpiryDate = t
+		case "last changed":
+			info.UpdatedDate = t
+		}
+	}
+
+	return info, nil
+}
+
+// dnsResolver is the recursive resolver DNSProvider queries directly, since
+// Go's net package exposes no way to fetch DNSKEY/DS records.
+const dnsResolver = "8.8.8.8:53"
+
+// DNSProvider records the apex's NS/MX/TXT/DNSKEY/DS record sets. DNSSECValid
+// here only means "signing material is present" (at least one DS record and
+// at least one DNSKEY record) - the DS digests are not checked against the
+// DNSKEYs, and no chain-of-trust validation is performed.
+type DNSProvider struct{}
+
+// Lookup implements Provider.
+func (DNSProvider) Lookup(ctx context.Context, domain string) (*DomainInfo, error) {
+	info := &DomainInfo{Domain: domain}
+
+	if answers, err := queryDNS(ctx, domain, dns.TypeNS); err == nil {
+		for _, rr := range answers {
+			if record, ok := rr.(*dns.NS); ok {
+				info.NameServers = append(info.NameServers, strings.TrimSuffix(record.Ns, "."))
+			}
+		}
+	}
+
+	if answers, err := queryDNS(ctx, domain, dns.TypeMX); err == nil {
+		for _, rr := range answers {
+			if record, ok := rr.(*dns.MX); ok {
+				info.MXRecords = append(info.MXRecords, strings.TrimSuffix(record.Mx, "."))
+			}
+		}
+	}
+
+	if answers, err := queryDNS(ctx, domain, dns.TypeTXT); err == nil {
+		for _, rr := range answers {
+			if record, ok := rr.(*dns.TXT); ok {
+				info.TXTRecords = append(info.TXTRecords, strings.Join(record.Txt, ""))
+			}
+		}
+	}
+
+	if answers, err := queryDNS(ctx, domain, dns.TypeDNSKEY); err == nil {
+		for _, rr := range answers {
+			if record, ok := rr.(*dns.DNSKEY); ok {
+				info.DNSKEYRecords = append(info.DNSKEYRecords, record.PublicKey)
+			}
+		}
+	}
+
+	if answers, err := queryDNS(ctx, domain, dns.TypeDS); err == nil {
+		for _, rr := range answers {
+			if record, ok := rr.(*dns.DS); ok {
+				info.DSRecords = append(info.DSRecords, record.Digest)
+			}
+		}
+	}
+
+	info.DNSSECValid = len(info.DSRecords) > 0 && len(info.DNSKEYRecords) > 0
+
+	if len(info.NameServers) == 0 && len(info.MXRecords) == 0 && len(info.TXTRecords) == 0 {
+		return nil, fmt.Errorf("dns: no records resolved for %s", domain)
+	}
+
+	return info, nil
+}
+
+func queryDNS(ctx context.Context, domain string, recordType uint16) ([]dns.RR, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(domain), recordType)
+	msg.RecursionDesired = true
+
+	client := &dns.Client{Timeout: 5 * time.Second}
+	resp, _, err := client.ExchangeContext(ctx, msg, dnsResolver)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("dns: query for %s %s failed with rcode %d", domain, dns.TypeToString[recordType], resp.Rcode)
+	}
+
+	return resp.Answer, nil
+}
+
+// ctLogEntry is the subset of a crt.sh JSON API entry this monitor uses.
+type ctLogEntry struct {
+	NameValue      string `json:"name_value"`
+	EntryTimestamp string `json:"entry_timestamp"`
+}
+
+// CTProvider records the SANs of the newest certificate transparency log
+// entry for the apex, so a newly issued certificate counts as a change.
+type CTProvider struct{}
+
+// Lookup implements Provider.
+func (CTProvider) Lookup(ctx context.Context, domain string) (*DomainInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://crt.sh/?q=%s&output=json", domain), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ct: unexpected status %d for %s", resp.StatusCode, domain)
+	}
+
+	var entries []ctLogEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("ct: no certificates found for %s", domain)
+	}
+
+	newest := entries[0]
+	newestIssued, _ := parseDate(newest.EntryTimestamp)
+	for _, entry := range entries[1:] {
+		if issued, ok := parseDate(entry.EntryTimestamp); ok && issued.After(newestIssued) {
+			newest, newestIssued = entry, issued
+		}
+	}
+
+	info := &DomainInfo{Domain: domain, CertificateIssuedAt: newestIssued}
+	seen := make(map[string]bool)
+	for _, san := range strings.Split(newest.NameValue, "\n") {
+		san = strings.TrimSpace(san)
+		if san != "" && !seen[san] {
+			seen[san] = true
+			info.CertificateSANs = append(info.CertificateSANs, san)
+		}
+	}
+
+	return info, nil
+}
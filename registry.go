@@ -0,0 +1,95 @@
+package main
+
+import "sync"
+
+// registryEntry pairs a Domain with where it came from, so Sync can tell a
+// config-defined domain (which should disappear when removed from the YAML)
+// from one added purely through the control API (which should survive a
+// config reload even though it's absent from config.Domains).
+type registryEntry struct {
+	domain     Domain
+	fromConfig bool
+}
+
+// DomainRegistry is the in-memory, mutex-guarded view of which domains the
+// scheduler currently monitors. It starts out seeded from Config.Domains,
+// and Sync keeps that part of the set in lockstep with the YAML file on
+// every reload; the control API can additionally add or remove domains at
+// runtime. Those additions live only in this in-memory registry: neither
+// config.yaml nor the state file records them, so they are not restored
+// after a restart.
+type DomainRegistry struct {
+	mu      sync.RWMutex
+	domains map[string]registryEntry
+}
+
+// NewDomainRegistry builds a registry seeded with the domains from config.
+func NewDomainRegistry(initial []Domain) *DomainRegistry {
+	r := &DomainRegistry{domains: make(map[string]registryEntry, len(initial))}
+	for _, domain := range initial {
+		r.domains[domain.Name] = registryEntry{domain: domain, fromConfig: true}
+	}
+	return r
+}
+
+// List returns a snapshot of the currently monitored domains.
+func (r *DomainRegistry) List() []Domain {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]Domain, 0, len(r.domains))
+	for _, entry := range r.domains {
+		out = append(out, entry.domain)
+	}
+	return out
+}
+
+// Get returns a single monitored domain by name.
+func (r *DomainRegistry) Get(name string) (Domain, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.domains[name]
+	return entry.domain, ok
+}
+
+// Add registers a domain for monitoring via the control API, replacing any
+// existing entry with the same name. It is never marked fromConfig, so a
+// later Sync won't remove it just because config.yaml doesn't list it.
+func (r *DomainRegistry) Add(domain Domain) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.domains[domain.Name] = registryEntry{domain: domain}
+}
+
+// Remove stops monitoring a domain, reporting whether it was present.
+func (r *DomainRegistry) Remove(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.domains[name]; !ok {
+		return false
+	}
+	delete(r.domains, name)
+	return true
+}
+
+// Sync reconciles the config-sourced portion of the registry against the
+// reloaded config.Domains: it adds new entries, refreshes existing ones
+// (e.g. a domain's webhooks changed), and removes config-sourced entries no
+// longer listed. Domains added purely through the control API are left
+// alone regardless of what config contains.
+func (r *DomainRegistry) Sync(configDomains []Domain) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	configNames := make(map[string]bool, len(configDomains))
+	for _, domain := range configDomains {
+		configNames[domain.Name] = true
+		r.domains[domain.Name] = registryEntry{domain: domain, fromConfig: true}
+	}
+
+	for name, entry := range r.domains {
+		if entry.fromConfig && !configNames[name] {
+			delete(r.domains, name)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Event is the structured payload handed to a Sink when a domain's
+// monitoring state changes. It replaces the free-form message string the
+// original SendWebhook built differently for each webhook type.
+type Event struct {
+	Domain     string
+	ChangeType string // "enabled", "finished", "expiry_warning", or one of domainFieldDiff's per-field types (e.g. "registrar_changed", "nameservers_added")
+	Message    string
+	Before     *DomainInfo // nil on a domain's first observation
+	After      *DomainInfo // nil once a domain is no longer configured
+
+	NameServersAdded   []string
+	NameServersRemoved []string
+
+	Timestamp time.Time
+}
+
+// newEvent builds an Event from a before/after DomainInfo pair, computing
+// the name server diff when both are available.
+func newEvent(domain, changeType, message string, before, after *DomainInfo) Event {
+	event := Event{
+		Domain:     domain,
+		ChangeType: changeType,
+		Message:    message,
+		Before:     before,
+		After:      after,
+		Timestamp:  time.Now(),
+	}
+
+	if before != nil && after != nil {
+		event.NameServersAdded, event.NameServersRemoved = diffNameServers(before.NameServers, after.NameServers)
+	}
+
+	return event
+}
+
+// diffNameServers set-compares two name server lists.
+func diffNameServers(before, after []string) (added, removed []string) {
+	beforeSet := make(map[string]bool, len(before))
+	for _, ns := range before {
+		beforeSet[ns] = true
+	}
+	afterSet := make(map[string]bool, len(after))
+	for _, ns := range after {
+		afterSet[ns] = true
+	}
+
+	for _, ns := range after {
+		if !beforeSet[ns] {
+			added = append(added, ns)
+		}
+	}
+	for _, ns := range before {
+		if !afterSet[ns] {
+			removed = append(removed, ns)
+		}
+	}
+
+	return added, removed
+}
+
+// Sink delivers an Event to an external system.
+type Sink interface {
+	Send(ctx context.Context, event Event) error
+}
+
+// NewSink builds the Sink for a configured Webhook.
+func NewSink(webhook Webhook) (Sink, error) {
+	switch webhook.Type {
+	case "pagerduty":
+		return PagerDutySink{URL: webhook.URL}, nil
+	case "teams":
+		return TeamsSink{URL: webhook.URL}, nil
+	case "discord":
+		return DiscordSink{URL: webhook.URL}, nil
+	case "slack":
+		return SlackSink{URL: webhook.URL}, nil
+	case "json":
+		return JSONSink{URL: webhook.URL}, nil
+	case "sentry":
+		return SentrySink{URL: webhook.URL}, nil
+	default:
+		return nil, fmt.Errorf("unsupported webhook type: %s", webhook.Type)
+	}
+}
+
+// dispatchEvent sends event to every webhook in dests that subscribes to
+// its change type, logging rather than failing the check on a per-sink
+// delivery error.
+func dispatchEvent(ctx context.Context, dests []Webhook, event Event) {
+	for _, webhook := range dests {
+		if !webhookSubscribed(webhook, event.ChangeType) {
+			continue
+		}
+
+		sink, err := NewSink(webhook)
+		if err != nil {
+			fmt.Printf("Error building sink for %s: %s\n", event.Domain, err)
+			continue
+		}
+		if err := sink.Send(ctx, event); err != nil {
+			fmt.Printf("Error sending webhook for %s: %s\n", event.Domain, err)
+		}
+	}
+}
+
+// webhookSubscribed reports whether webhook should receive an event of
+// changeType. An empty Webhook.On subscribes to everything, preserving the
+// original behavior for webhooks that don't opt into filtering.
+func webhookSubscribed(webhook Webhook, changeType string) bool {
+	if len(webhook.On) == 0 {
+		return true
+	}
+	for _, want := range webhook.On {
+		if want == changeType {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAttempts and retryBaseDelay bound the exponential backoff every sink
+// goes through via postJSON.
+const (
+	retryAttempts  = 4
+	retryBaseDelay = 500 * time.Millisecond
+	webhookTimeout = 10 * time.Second
+)
+
+// postJSON POSTs payload to url, retrying on failure with exponential
+// backoff and jitter. A 429/503 response honors the Retry-After header in
+// place of the computed backoff when the server sends one.
+func postJSON(ctx context.Context, url string, payload []byte) error {
+	client := &http.Client{Timeout: webhookTimeout}
+
+	var lastErr error
+	delay := retryBaseDelay
+
+	for attempt := 1; attempt <= retryAttempts; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+		} else {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode < 300 {
+				return nil
+			}
+
+			lastErr = fmt.Errorf("received non-2xx response status: %d: %s", resp.StatusCode, string(body))
+
+			if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+				if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+					delay = retryAfter
+				}
+			}
+		}
+
+		if attempt == retryAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay + jitter(delay)):
+		}
+		delay *= 2
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", retryAttempts, lastErr)
+}
+
+// parseRetryAfter parses a Retry-After header, which may be either a number
+// of seconds or an HTTP date.
+func parseRetryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		return time.Until(when), true
+	}
+	return 0, false
+}
+
+// jitter returns a random duration in [0, base], so retries from multiple
+// domains don't all land on the same backoff schedule.
+func jitter(base time.Duration) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(base) + 1))
+}
+
+// PagerDutySink triggers a PagerDuty Events API v2 incident. URL is both the
+// routing key and the POST destination, matching how this monitor has
+// always been configured against PagerDuty.
+type PagerDutySink struct{ URL string }
+
+// Send implements Sink.
+func (s PagerDutySink) Send(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"payload": map[string]string{
+			"summary":  event.Message,
+			"severity": "info",
+			"source":   "domain-monitor",
+		},
+		"routing_key":  s.URL,
+		"event_action": "trigger",
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, s.URL, payload)
+}
+
+// TeamsSink posts a plain-text message to a Microsoft Teams incoming webhook.
+type TeamsSink struct{ URL string }
+
+// Send implements Sink.
+func (s TeamsSink) Send(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(map[string]string{"text": event.Message})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, s.URL, payload)
+}
+
+// DiscordSink posts an embed to a Discord incoming webhook.
+type DiscordSink struct{ URL string }
+
+// Send implements Sink.
+func (s DiscordSink) Send(ctx context.Context, event Event) error {
+	info := event.After
+	if info == nil {
+		info = event.Before
+	}
+
+	embed := map[string]interface{}{
+		"title":       event.Message,
+		"description": discordDescription(info),
+		"color":       3447003, // Blue color
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"embeds": []map[string]interface{}{embed},
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, s.URL, payload)
+}
+
+func discordDescription(info *DomainInfo) string {
+	if info == nil {
+		return ""
+	}
+	return fmt.Sprintf("Details: \n- Domain: %s\n- Registrar: %s\n- Name Servers: %v\n- Creation Date: %s\n- Expiry Date: %s\n- Updated Date: %s\n- IP Address: %s",
+		info.Domain, info.RegistrarTag, info.NameServers, info.CreationDate, info.ExpiryDate, info.UpdatedDate, info.IPAddress)
+}
+
+// SlackSink posts a blocks-formatted message to a Slack incoming webhook.
+type SlackSink struct{ URL string }
+
+// Send implements Sink.
+func (s SlackSink) Send(ctx context.Context, event Event) error {
+	fields := []map[string]string{
+		{"type": "mrkdwn", "text": fmt.Sprintf("*Domain:*\n%s", event.Domain)},
+		{"type": "mrkdwn", "text": fmt.Sprintf("*Change:*\n%s", event.ChangeType)},
+	}
+	if len(event.NameServersAdded) > 0 {
+		fields = append(fields, map[string]string{"type": "mrkdwn", "text": fmt.Sprintf("*Name servers added:*\n%v", event.NameServersAdded)})
+	}
+	if len(event.NameServersRemoved) > 0 {
+		fields = append(fields, map[string]string{"type": "mrkdwn", "text": fmt.Sprintf("*Name servers removed:*\n%v", event.NameServersRemoved)})
+	}
+
+	blocks := []map[string]interface{}{
+		{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": event.Message},
+		},
+		{
+			"type":   "section",
+			"fields": fields,
+		},
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{"blocks": blocks})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, s.URL, payload)
+}
+
+// JSONSink POSTs the raw Event as JSON, for users who want to pipe domain
+// changes into their own receiver rather than a chat/paging integration.
+type JSONSink struct{ URL string }
+
+// Send implements Sink.
+func (s JSONSink) Send(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, s.URL, payload)
+}
+
+// SentrySink captures expiry-soon and structural change events, fingerprinted
+// per domain and change type so Sentry groups repeat occurrences together.
+type SentrySink struct{ URL string }
+
+// sentryChangeTypes are the ChangeTypes SentrySink reports; noisy or purely
+// informational ones (e.g. "enabled", "updated_date_changed") are left to
+// the other sinks.
+var sentryChangeTypes = map[string]bool{
+	"expiry_warning":        true,
+	"expiry_shortened":      true,
+	"registrar_changed":     true,
+	"nameservers_added":     true,
+	"nameservers_removed":   true,
+	"ip_changed":            true,
+	"creation_date_changed": true,
+}
+
+// Send implements Sink.
+func (s SentrySink) Send(ctx context.Context, event Event) error {
+	if !sentryChangeTypes[event.ChangeType] {
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"message":     event.Message,
+		"level":       "warning",
+		"fingerprint": []string{"domainmonitor", event.Domain, event.ChangeType},
+		"extra": map[string]interface{}{
+			"domain":               event.Domain,
+			"change_type":          event.ChangeType,
+			"name_servers_added":   event.NameServersAdded,
+			"name_servers_removed": event.NameServersRemoved,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, s.URL, payload)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// StateFile is the on-disk snapshot of monitoring state persisted across
+// restarts: the last DomainInfo observed per domain, when each domain was
+// last notified, and which expiry warning thresholds have already fired.
+// Loading it on startup lets MonitorDomains diff against the last real
+// observation instead of treating every domain as newly added on every
+// process launch. mu guards concurrent access from the control API's HTTP
+// handlers running alongside the scheduler goroutine.
+type StateFile struct {
+	mu sync.RWMutex
+
+	Domains            map[string]*DomainInfo `json:"domains"`
+	LastNotified       map[string]time.Time   `json:"last_notified"`
+	ExpiryWarningsSent map[string][]int       `json:"expiry_warnings_sent"` // domain -> thresholds already notified
+}
+
+// NewStateFile returns an empty state, as used on a domain's first run.
+func NewStateFile() *StateFile {
+	return &StateFile{
+		Domains:            make(map[string]*DomainInfo),
+		LastNotified:       make(map[string]time.Time),
+		ExpiryWarningsSent: make(map[string][]int),
+	}
+}
+
+// LoadState reads a previously persisted state file. Only the "file" backend
+// is currently implemented; an empty path disables persistence entirely and
+// every run behaves as a first run. A missing file is not an error.
+func LoadState(path string) (*StateFile, error) {
+	if path == "" {
+		return NewStateFile(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewStateFile(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := NewStateFile()
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("state: failed to parse %s: %w", path, err)
+	}
+
+	return state, nil
+}
+
+// snapshotDomains returns a shallow copy of the current domain snapshots.
+func (s *StateFile) snapshotDomains() map[string]*DomainInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make(map[string]*DomainInfo, len(s.Domains))
+	for name, info := range s.Domains {
+		out[name] = info
+	}
+	return out
+}
+
+// getDomain returns the last observed DomainInfo and notification time for
+// a domain, as used by the control API's detail endpoint.
+func (s *StateFile) getDomain(name string) (info *DomainInfo, lastNotified time.Time, found bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info, found = s.Domains[name]
+	return info, s.LastNotified[name], found
+}
+
+// setDomain records the latest DomainInfo observed for a domain.
+func (s *StateFile) setDomain(name string, info *DomainInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Domains[name] = info
+}
+
+// markNotified records that a domain was just notified about.
+func (s *StateFile) markNotified(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.LastNotified[name] = time.Now()
+}
+
+// forgetDomain removes every trace of a domain from state, as used when a
+// domain is dropped from config or removed via the control API.
+func (s *StateFile) forgetDomain(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Domains, name)
+	delete(s.LastNotified, name)
+	delete(s.ExpiryWarningsSent, name)
+}
+
+// sentExpiryWarnings returns the thresholds already notified for a domain.
+func (s *StateFile) sentExpiryWarnings(name string) []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]int(nil), s.ExpiryWarningsSent[name]...)
+}
+
+// recordExpiryWarnings appends newly-fired thresholds for a domain.
+func (s *StateFile) recordExpiryWarnings(name string, thresholds []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ExpiryWarningsSent[name] = append(s.ExpiryWarningsSent[name], thresholds...)
+}
+
+// clearExpiryWarnings resets the thresholds sent for a domain, used when
+// its expiry date is extended so the countdown can fire again on renewal.
+func (s *StateFile) clearExpiryWarnings(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ExpiryWarningsSent, name)
+}
+
+// SaveState persists state to path by writing to a temp file in the same
+// directory and renaming it into place, so a crash mid-write leaves the
+// previous, still-valid state file intact rather than a truncated one.
+func SaveState(path string, state *StateFile) error {
+	if path == "" {
+		return nil
+	}
+
+	state.mu.RLock()
+	data, err := json.MarshalIndent(state, "", "  ")
+	state.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, ".domainmonitor-state-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("state: failed to install %s: %w", path, err)
+	}
+
+	return nil
+}